@@ -0,0 +1,64 @@
+package hugohandler
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os/exec"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// NewContentEndpoint exposes POST /hugo/new on the standard admin API
+// (subject to the admin API's usual auth), shelling out to `hugo new` for
+// content scaffolding.
+type NewContentEndpoint struct{}
+
+// CaddyModule implements caddy.Module.
+func (NewContentEndpoint) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "admin.api.hugo",
+		New: func() caddy.Module { return new(NewContentEndpoint) },
+	}
+}
+
+// Routes implements caddy.AdminRouter.
+func (NewContentEndpoint) Routes() []caddy.AdminRoute {
+	return []caddy.AdminRoute{
+		{
+			Pattern: "/hugo/new",
+			Handler: caddy.AdminHandlerFunc(handleNewContent),
+		},
+	}
+}
+
+func handleNewContent(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return caddy.APIError{HTTPStatus: http.StatusMethodNotAllowed, Err: fmt.Errorf("method not allowed")}
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		return caddy.APIError{HTTPStatus: http.StatusBadRequest, Err: fmt.Errorf("name is required")}
+	}
+
+	args := []string{"new"}
+	if kind := r.URL.Query().Get("kind"); kind != "" {
+		args = append(args, "--kind", kind)
+	}
+	args = append(args, name)
+
+	cmd := exec.Command("hugo", args...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return caddy.APIError{HTTPStatus: http.StatusInternalServerError, Err: fmt.Errorf("hugo new failed: %w: %s", err, out.String())}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+var _ caddy.AdminRouter = (*NewContentEndpoint)(nil)
@@ -0,0 +1,342 @@
+// Package hugohandler builds and serves a Hugo site, rebuilding whenever
+// its source files change and pushing connected browsers a reload over a
+// websocket. It is registered under the Caddyfile "hugo" directive.
+//
+// Hugo doesn't expose a stable, embeddable render API - hugolib is an
+// internal package with no compatibility promise - so builds are done by
+// shelling out to the real `hugo` binary on PATH into a scratch directory.
+// afero then fronts that directory as the virtual filesystem responses are
+// served from, which is also where an in-process render would plug in if
+// Hugo ever ships one.
+package hugohandler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/fsnotify/fsnotify"
+	"github.com/gorilla/websocket"
+	"github.com/spf13/afero"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(new(Handler))
+	caddy.RegisterModule(new(NewContentEndpoint))
+	httpcaddyfile.RegisterHandlerDirective("hugo", parseCaddyfile)
+}
+
+const livereloadPath = "/__hugo_livereload"
+
+var livereloadScript = []byte(`<script>(function(){var s=new WebSocket((location.protocol==="https:"?"wss://":"ws://")+location.host+"` +
+	livereloadPath + `");s.onmessage=function(){location.reload()};})();</script>`)
+
+// Handler builds a Hugo site on provision, serves it from a virtual
+// filesystem, rebuilds on source changes, and injects a livereload script
+// into HTML responses.
+type Handler struct {
+	// SourceDir is the Hugo source tree to build.
+	SourceDir string `json:"source_dir,omitempty"`
+	// DebounceInterval coalesces a burst of filesystem events into a
+	// single rebuild. Defaults to 300ms.
+	DebounceInterval caddy.Duration `json:"debounce_interval,omitempty"`
+
+	logger *zap.Logger
+
+	mu       sync.RWMutex
+	buildDir string
+	fs       afero.Fs
+
+	watcher *fsnotify.Watcher
+	closing chan struct{}
+
+	clientsMu sync.Mutex
+	clients   map[*websocket.Conn]struct{}
+	upgrader  websocket.Upgrader
+}
+
+// CaddyModule implements caddy.Module.
+func (Handler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.hugo",
+		New: func() caddy.Module { return new(Handler) },
+	}
+}
+
+// Provision implements caddy.Provisioner.
+func (h *Handler) Provision(ctx caddy.Context) error {
+	h.logger = ctx.Logger()
+	if h.DebounceInterval == 0 {
+		h.DebounceInterval = caddy.Duration(300 * time.Millisecond)
+	}
+	h.closing = make(chan struct{})
+	h.clients = make(map[*websocket.Conn]struct{})
+
+	if err := h.build(); err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("creating hugo watcher: %w", err)
+	}
+	for _, rel := range []string{"content", "layouts", "static", "config.toml"} {
+		p := filepath.Join(h.SourceDir, rel)
+		if _, err := os.Stat(p); err != nil {
+			continue
+		}
+		if err := watcher.Add(p); err != nil {
+			watcher.Close()
+			return fmt.Errorf("watching %s: %w", p, err)
+		}
+	}
+	h.watcher = watcher
+	go h.watch()
+
+	return nil
+}
+
+// build runs the real hugo binary against SourceDir into a fresh scratch
+// directory, then swaps it in so in-flight requests keep serving the
+// prior generation until the new one is ready.
+func (h *Handler) build() error {
+	dir, err := os.MkdirTemp("", "hugo-build-*")
+	if err != nil {
+		return fmt.Errorf("creating build dir: %w", err)
+	}
+
+	cmd := exec.Command("hugo", "--source", h.SourceDir, "--destination", dir)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.RemoveAll(dir)
+		return fmt.Errorf("hugo build failed: %w: %s", err, stderr.String())
+	}
+
+	h.mu.Lock()
+	oldDir := h.buildDir
+	h.buildDir = dir
+	h.fs = afero.NewBasePathFs(afero.NewOsFs(), dir)
+	h.mu.Unlock()
+
+	if oldDir != "" {
+		os.RemoveAll(oldDir)
+	}
+	return nil
+}
+
+// watch rebuilds the site, debounced, whenever a watched path changes,
+// and pushes a reload to connected livereload clients once it's done.
+func (h *Handler) watch() {
+	var timer *time.Timer
+	rebuild := func() {
+		if err := h.build(); err != nil {
+			h.logger.Error("rebuilding hugo site", zap.Error(err))
+			return
+		}
+		h.logger.Info("rebuilt hugo site", zap.String("source", h.SourceDir))
+		h.broadcastReload()
+	}
+	for {
+		select {
+		case <-h.closing:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case ev, ok := <-h.watcher.Events:
+			if !ok {
+				return
+			}
+			if ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+				continue
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.AfterFunc(time.Duration(h.DebounceInterval), rebuild)
+		case err, ok := <-h.watcher.Errors:
+			if !ok {
+				return
+			}
+			h.logger.Error("hugo watcher error", zap.Error(err))
+		}
+	}
+}
+
+func (h *Handler) broadcastReload() {
+	h.clientsMu.Lock()
+	defer h.clientsMu.Unlock()
+	for c := range h.clients {
+		if err := c.WriteMessage(websocket.TextMessage, []byte("reload")); err != nil {
+			c.Close()
+			delete(h.clients, c)
+		}
+	}
+}
+
+// ServeHTTP implements caddyhttp.MiddlewareHandler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	if r.URL.Path == livereloadPath {
+		return h.serveLivereload(w, r)
+	}
+
+	h.mu.RLock()
+	fs := h.fs
+	h.mu.RUnlock()
+
+	reqPath := path.Clean(r.URL.Path)
+	if strings.HasSuffix(r.URL.Path, "/") || reqPath == "." {
+		reqPath = path.Join(reqPath, "index.html")
+	}
+
+	f, err := fs.Open(reqPath)
+	if err != nil {
+		return next.ServeHTTP(w, r)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256([]byte(fmt.Sprintf("%s-%d-%d", reqPath, info.ModTime().UnixNano(), info.Size()))))
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	if ct := mime.TypeByExtension(filepath.Ext(reqPath)); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+
+	if strings.HasSuffix(reqPath, ".html") || strings.HasSuffix(reqPath, ".htm") {
+		body, err := io.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		body = injectLivereload(body)
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		_, err = w.Write(body)
+		return err
+	}
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func injectLivereload(body []byte) []byte {
+	i := bytes.LastIndex(body, []byte("</body>"))
+	if i < 0 {
+		return append(body, livereloadScript...)
+	}
+	out := make([]byte, 0, len(body)+len(livereloadScript))
+	out = append(out, body[:i]...)
+	out = append(out, livereloadScript...)
+	out = append(out, body[i:]...)
+	return out
+}
+
+func (h *Handler) serveLivereload(w http.ResponseWriter, r *http.Request) error {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return err
+	}
+
+	h.clientsMu.Lock()
+	h.clients[conn] = struct{}{}
+	h.clientsMu.Unlock()
+
+	defer func() {
+		h.clientsMu.Lock()
+		delete(h.clients, conn)
+		h.clientsMu.Unlock()
+		conn.Close()
+	}()
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return nil
+		}
+	}
+}
+
+// Cleanup implements caddy.CleanerUpper.
+func (h *Handler) Cleanup() error {
+	close(h.closing)
+	if h.watcher != nil {
+		h.watcher.Close()
+	}
+	h.clientsMu.Lock()
+	for c := range h.clients {
+		c.Close()
+	}
+	h.clientsMu.Unlock()
+	if h.buildDir != "" {
+		os.RemoveAll(h.buildDir)
+	}
+	return nil
+}
+
+// UnmarshalCaddyfile implements caddyfile.Unmarshaler.
+//
+//	hugo <source_dir> {
+//	    debounce <duration>
+//	}
+func (h *Handler) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		h.SourceDir = d.Val()
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		for nesting := d.Nesting(); d.NextBlock(nesting); {
+			switch d.Val() {
+			case "debounce":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(d.Val())
+				if err != nil {
+					return d.Errf("invalid debounce: %v", err)
+				}
+				h.DebounceInterval = caddy.Duration(dur)
+			default:
+				return d.Errf("unrecognized subdirective %q", d.Val())
+			}
+		}
+	}
+	return nil
+}
+
+func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	var m Handler
+	err := m.UnmarshalCaddyfile(h.Dispenser)
+	return &m, err
+}
+
+var (
+	_ caddy.Provisioner           = (*Handler)(nil)
+	_ caddy.CleanerUpper          = (*Handler)(nil)
+	_ caddyhttp.MiddlewareHandler = (*Handler)(nil)
+	_ caddyfile.Unmarshaler       = (*Handler)(nil)
+)
@@ -0,0 +1,57 @@
+package hugohandler
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+func TestUnmarshalCaddyfile(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`hugo /srv/site {
+		debounce 500ms
+	}`)
+
+	var h Handler
+	if err := h.UnmarshalCaddyfile(d); err != nil {
+		t.Fatalf("UnmarshalCaddyfile: %v", err)
+	}
+	if h.SourceDir != "/srv/site" {
+		t.Errorf("SourceDir = %q, want /srv/site", h.SourceDir)
+	}
+	if time.Duration(h.DebounceInterval) != 500*time.Millisecond {
+		t.Errorf("DebounceInterval = %s, want 500ms", time.Duration(h.DebounceInterval))
+	}
+}
+
+func TestUnmarshalCaddyfileRejectsExtraArg(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`hugo /srv/site extra`)
+
+	var h Handler
+	if err := h.UnmarshalCaddyfile(d); err == nil {
+		t.Fatal("expected an error for a second positional argument, got nil")
+	}
+}
+
+func TestInjectLivereloadWithBodyTag(t *testing.T) {
+	in := []byte("<html><body><p>hi</p></body></html>")
+	out := injectLivereload(in)
+	if !bytes.Contains(out, livereloadScript) {
+		t.Fatal("expected output to contain the livereload script")
+	}
+	if !bytes.Contains(out, []byte("<p>hi</p>")) {
+		t.Fatal("expected output to retain the original body")
+	}
+	if bytes.Index(out, livereloadScript) > bytes.Index(out, []byte("</body>")) {
+		t.Fatal("expected the livereload script to be injected before </body>")
+	}
+}
+
+func TestInjectLivereloadWithoutBodyTag(t *testing.T) {
+	in := []byte("<html><p>no body tag</p></html>")
+	out := injectLivereload(in)
+	if !bytes.HasSuffix(out, livereloadScript) {
+		t.Fatal("expected the livereload script to be appended when there's no </body>")
+	}
+}
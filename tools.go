@@ -10,4 +10,10 @@ import (
   _ "github.com/monobilisim/caddy-ip-list"
   _ "github.com/WeidiDeng/caddy-cloudflare-ip"
   _ "github.com/xcaddyplugins/caddy-trusted-cloudfront"
+  _ "github.com/ivanphz/my-custom-caddy/wasmhandler"
+  _ "github.com/tailscale/caddy-tailscale"
+  _ "github.com/caddyserver/cache-handler"
+  _ "github.com/dunglas/mercure/caddy"
+  _ "github.com/aksdb/caddy-cgi/v2"
+  _ "github.com/ivanphz/my-custom-caddy/hugohandler"
 )
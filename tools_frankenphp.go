@@ -0,0 +1,9 @@
+//go:build tools && frankenphp
+
+package main
+
+// frankenphp links libphp via cgo, so it's kept behind its own build tag:
+// `go build -tags "tools frankenphp"` opts in, the plain `tools` tag does not.
+import (
+  _ "github.com/dunglas/frankenphp/caddy"
+)
@@ -0,0 +1,375 @@
+// Package wasmhandler runs an HTTP handler backed by a WebAssembly guest
+// module, executed in-process with wazero. It is registered under the
+// Caddyfile "wasm" directive.
+//
+// wazero does not yet ship a stable wasi-http ABI, so the guest exchanges
+// HTTP data with the host over its WASI preview1 stdin/stdout: the host
+// writes a request line, headers, a blank line and the body to stdin, and
+// the guest is expected to write a full HTTP response (status line,
+// headers, blank line, body) to stdout.
+package wasmhandler
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/fsnotify/fsnotify"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(new(Handler))
+	httpcaddyfile.RegisterHandlerDirective("wasm", parseCaddyfile)
+}
+
+// Handler dispatches each request to a WebAssembly guest instance,
+// instantiated fresh per call but bounded by Instances so that only that
+// many guest invocations ever run concurrently.
+type Handler struct {
+	// Path is the compiled .wasm guest module to load.
+	Path string `json:"path,omitempty"`
+	// Instances caps how many guest invocations may run concurrently.
+	// Defaults to 1.
+	Instances int `json:"instances,omitempty"`
+	// MemoryLimitPages caps each instance's linear memory, in 64KiB pages.
+	MemoryLimitPages uint32 `json:"memory_limit_pages,omitempty"`
+	// Timeout bounds a single invocation; on expiry the guest's context
+	// is canceled and the call aborted.
+	Timeout caddy.Duration `json:"timeout,omitempty"`
+	// PreopenDirs maps host directories the guest may access to the
+	// guest-visible path, e.g. {"/srv/data": "/data"}.
+	PreopenDirs map[string]string `json:"preopen_dirs,omitempty"`
+	// Env passes environment variables through to the guest.
+	Env map[string]string `json:"env,omitempty"`
+
+	logger *zap.Logger
+
+	mu       sync.RWMutex
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+
+	sem     chan struct{}
+	watcher *fsnotify.Watcher
+	closing chan struct{}
+}
+
+// CaddyModule implements caddy.Module.
+func (Handler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.wasm",
+		New: func() caddy.Module { return new(Handler) },
+	}
+}
+
+// Provision implements caddy.Provisioner.
+func (h *Handler) Provision(ctx caddy.Context) error {
+	h.logger = ctx.Logger()
+	if h.Instances <= 0 {
+		h.Instances = 1
+	}
+	h.sem = make(chan struct{}, h.Instances)
+	h.closing = make(chan struct{})
+
+	if err := h.compile(ctx); err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("creating wasm watcher: %w", err)
+	}
+	if err := watcher.Add(h.Path); err != nil {
+		watcher.Close()
+		return fmt.Errorf("watching %s: %w", h.Path, err)
+	}
+	h.watcher = watcher
+	go h.watch()
+
+	return nil
+}
+
+// compile (re)builds the runtime and compiled module from h.Path, swapping
+// it in atomically so in-flight requests keep using the prior generation.
+func (h *Handler) compile(ctx context.Context) error {
+	cfg := wazero.NewRuntimeConfig().WithCloseOnContextDone(true)
+	if h.MemoryLimitPages > 0 {
+		cfg = cfg.WithMemoryLimitPages(h.MemoryLimitPages)
+	}
+	rt := wazero.NewRuntimeWithConfig(ctx, cfg)
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, rt); err != nil {
+		rt.Close(ctx)
+		return fmt.Errorf("instantiating wasi_snapshot_preview1: %w", err)
+	}
+
+	wasmBytes, err := os.ReadFile(h.Path)
+	if err != nil {
+		rt.Close(ctx)
+		return fmt.Errorf("reading %s: %w", h.Path, err)
+	}
+	compiled, err := rt.CompileModule(ctx, wasmBytes)
+	if err != nil {
+		rt.Close(ctx)
+		return fmt.Errorf("compiling %s: %w", h.Path, err)
+	}
+
+	h.mu.Lock()
+	oldRuntime, oldCompiled := h.runtime, h.compiled
+	h.runtime, h.compiled = rt, compiled
+	h.mu.Unlock()
+
+	if oldRuntime != nil {
+		// ServeHTTP takes a sem slot before reading h.runtime, so holding
+		// every slot means no invocation is still running on the prior
+		// generation when it is closed.
+		for i := 0; i < cap(h.sem); i++ {
+			h.sem <- struct{}{}
+		}
+		for i := 0; i < cap(h.sem); i++ {
+			<-h.sem
+		}
+		_ = oldCompiled.Close(ctx)
+		_ = oldRuntime.Close(ctx)
+	}
+	return nil
+}
+
+// watch reloads the guest module whenever its file changes, so operators
+// can drop in a new .wasm build without restarting Caddy.
+func (h *Handler) watch() {
+	for {
+		select {
+		case <-h.closing:
+			return
+		case ev, ok := <-h.watcher.Events:
+			if !ok {
+				return
+			}
+			if ev.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			if err := h.compile(context.Background()); err != nil {
+				h.logger.Error("reloading wasm module", zap.Error(err))
+				continue
+			}
+			h.logger.Info("reloaded wasm module", zap.String("path", h.Path))
+		case err, ok := <-h.watcher.Errors:
+			if !ok {
+				return
+			}
+			h.logger.Error("wasm watcher error", zap.Error(err))
+		}
+	}
+}
+
+// ServeHTTP implements caddyhttp.MiddlewareHandler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	ctx := r.Context()
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(h.Timeout))
+		defer cancel()
+	}
+
+	select {
+	case h.sem <- struct{}{}:
+		defer func() { <-h.sem }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	stdinR, stdinW := io.Pipe()
+	go func() {
+		var err error
+		defer func() { stdinW.CloseWithError(err) }()
+		if _, err = fmt.Fprintf(stdinW, "%s %s\n", r.Method, r.URL.RequestURI()); err != nil {
+			return
+		}
+		for k, vs := range r.Header {
+			for _, v := range vs {
+				if _, err = fmt.Fprintf(stdinW, "%s: %s\n", k, v); err != nil {
+					return
+				}
+			}
+		}
+		if _, err = io.WriteString(stdinW, "\n"); err != nil {
+			return
+		}
+		_, err = io.Copy(stdinW, r.Body)
+	}()
+
+	stdoutR, stdoutW := io.Pipe()
+
+	fsConfig := wazero.NewFSConfig()
+	for hostDir, guestDir := range h.PreopenDirs {
+		fsConfig = fsConfig.WithDirMount(hostDir, guestDir)
+	}
+
+	modCfg := wazero.NewModuleConfig().
+		WithStdin(stdinR).
+		WithStdout(stdoutW).
+		WithStderr(os.Stderr).
+		WithFSConfig(fsConfig)
+	for k, v := range h.Env {
+		modCfg = modCfg.WithEnv(k, v)
+	}
+
+	h.mu.RLock()
+	rt, compiled := h.runtime, h.compiled
+	h.mu.RUnlock()
+
+	invokeErr := make(chan error, 1)
+	go func() {
+		mod, err := rt.InstantiateModule(ctx, compiled, modCfg)
+		if err == nil {
+			defer mod.Close(ctx)
+		}
+		stdoutW.CloseWithError(err)
+		invokeErr <- err
+	}()
+
+	if err := writeGuestResponse(w, stdoutR); err != nil {
+		<-invokeErr
+		return fmt.Errorf("invoking wasm guest %s: %w", h.Path, err)
+	}
+	return <-invokeErr
+}
+
+// writeGuestResponse streams the guest's stdout straight through to w: it
+// parses only the status line and headers into memory, then copies the
+// body a chunk at a time rather than buffering the whole response.
+func writeGuestResponse(w http.ResponseWriter, stdout io.Reader) error {
+	br := bufio.NewReader(stdout)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, werr := io.Copy(w, br)
+		if werr != nil {
+			return werr
+		}
+		return nil
+	}
+	defer resp.Body.Close()
+	for k, vs := range resp.Header {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// Cleanup implements caddy.CleanerUpper.
+func (h *Handler) Cleanup() error {
+	close(h.closing)
+	if h.watcher != nil {
+		h.watcher.Close()
+	}
+	ctx := context.Background()
+	if h.compiled != nil {
+		h.compiled.Close(ctx)
+	}
+	if h.runtime != nil {
+		return h.runtime.Close(ctx)
+	}
+	return nil
+}
+
+// UnmarshalCaddyfile implements caddyfile.Unmarshaler.
+//
+//	wasm <path> {
+//	    instances     <n>
+//	    memory_limit  <pages>
+//	    timeout       <duration>
+//	    preopen       <host_dir> <guest_dir>
+//	    env           <name> <value>
+//	}
+func (h *Handler) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		h.Path = d.Val()
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		for nesting := d.Nesting(); d.NextBlock(nesting); {
+			switch d.Val() {
+			case "instances":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				n, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return d.Errf("invalid instances: %v", err)
+				}
+				h.Instances = n
+			case "memory_limit":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				n, err := strconv.ParseUint(d.Val(), 10, 32)
+				if err != nil {
+					return d.Errf("invalid memory_limit: %v", err)
+				}
+				h.MemoryLimitPages = uint32(n)
+			case "timeout":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				dur, err := caddy.ParseDuration(d.Val())
+				if err != nil {
+					return d.Errf("invalid timeout: %v", err)
+				}
+				h.Timeout = caddy.Duration(dur)
+			case "preopen":
+				args := d.RemainingArgs()
+				if len(args) != 2 {
+					return d.ArgErr()
+				}
+				if h.PreopenDirs == nil {
+					h.PreopenDirs = map[string]string{}
+				}
+				h.PreopenDirs[args[0]] = args[1]
+			case "env":
+				args := d.RemainingArgs()
+				if len(args) != 2 {
+					return d.ArgErr()
+				}
+				if h.Env == nil {
+					h.Env = map[string]string{}
+				}
+				h.Env[args[0]] = args[1]
+			default:
+				return d.Errf("unrecognized subdirective %q", d.Val())
+			}
+		}
+	}
+	return nil
+}
+
+func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	var m Handler
+	err := m.UnmarshalCaddyfile(h.Dispenser)
+	return &m, err
+}
+
+var (
+	_ caddy.Provisioner           = (*Handler)(nil)
+	_ caddy.CleanerUpper          = (*Handler)(nil)
+	_ caddyhttp.MiddlewareHandler = (*Handler)(nil)
+	_ caddyfile.Unmarshaler       = (*Handler)(nil)
+)
@@ -0,0 +1,62 @@
+package wasmhandler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+func TestUnmarshalCaddyfile(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`wasm /srv/guest.wasm {
+		instances 4
+		memory_limit 16
+		timeout 5s
+		preopen /srv/data /data
+		env FOO bar
+	}`)
+
+	var h Handler
+	if err := h.UnmarshalCaddyfile(d); err != nil {
+		t.Fatalf("UnmarshalCaddyfile: %v", err)
+	}
+
+	if h.Path != "/srv/guest.wasm" {
+		t.Errorf("Path = %q, want /srv/guest.wasm", h.Path)
+	}
+	if h.Instances != 4 {
+		t.Errorf("Instances = %d, want 4", h.Instances)
+	}
+	if h.MemoryLimitPages != 16 {
+		t.Errorf("MemoryLimitPages = %d, want 16", h.MemoryLimitPages)
+	}
+	if time.Duration(h.Timeout) != 5*time.Second {
+		t.Errorf("Timeout = %s, want 5s", time.Duration(h.Timeout))
+	}
+	if got := h.PreopenDirs["/srv/data"]; got != "/data" {
+		t.Errorf("PreopenDirs[/srv/data] = %q, want /data", got)
+	}
+	if got := h.Env["FOO"]; got != "bar" {
+		t.Errorf("Env[FOO] = %q, want bar", got)
+	}
+}
+
+func TestUnmarshalCaddyfileRejectsExtraArg(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`wasm /srv/guest.wasm extra`)
+
+	var h Handler
+	if err := h.UnmarshalCaddyfile(d); err == nil {
+		t.Fatal("expected an error for a second positional argument, got nil")
+	}
+}
+
+func TestUnmarshalCaddyfileRejectsUnknownSubdirective(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`wasm /srv/guest.wasm {
+		bogus value
+	}`)
+
+	var h Handler
+	if err := h.UnmarshalCaddyfile(d); err == nil {
+		t.Fatal("expected an error for an unrecognized subdirective, got nil")
+	}
+}